@@ -0,0 +1,340 @@
+/*
+Copyright 2018 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"knative.dev/pkg/ptr"
+	"knative.dev/serving/pkg/deployment"
+)
+
+// seccompProfileAnnotation is the literal key backing
+// serving.QueueSidecarSeccompProfileAnnotation.
+const seccompProfileAnnotation = "queue.sidecar.serving.knative.dev/seccompProfile"
+
+// appArmorProfileAnnotation is the literal key backing
+// serving.QueueSidecarAppArmorProfileAnnotation.
+const appArmorProfileAnnotation = "queue.sidecar.serving.knative.dev/apparmorProfile"
+
+// startupGracePeriodAnnotation is the literal key backing
+// serving.QueueSidecarStartupProbeAnnotation, used here to build test
+// annotation maps without depending on that kmap.KeyPriority's internals.
+const startupGracePeriodAnnotation = "queue.sidecar.serving.knative.dev/startupGracePeriodSeconds"
+
+// cpuLimitRequestFactorAnnotation and memoryLimitRequestFactorAnnotation are
+// the literal keys backing serving.QueueSidecarCPULimitRequestFactorAnnotation
+// and serving.QueueSidecarMemoryLimitRequestFactorAnnotation respectively.
+const (
+	cpuLimitRequestFactorAnnotation    = "queue.sidecar.serving.knative.dev/user-container-cpu-limit-request-factor"
+	memoryLimitRequestFactorAnnotation = "queue.sidecar.serving.knative.dev/user-container-memory-limit-request-factor"
+)
+
+func TestLimitRequestFactor(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		want  float64
+		wantOK bool
+	}{{
+		name:   "valid positive factor",
+		value:  "2",
+		want:   2,
+		wantOK: true,
+	}, {
+		name:  "zero is rejected",
+		value: "0",
+	}, {
+		name:  "negative is rejected",
+		value: "-1",
+	}, {
+		name:  "non-numeric is rejected",
+		value: "nope",
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := limitRequestFactor(map[string]string{cpuLimitRequestFactorAnnotation: c.value}, []string{cpuLimitRequestFactorAnnotation})
+			if ok != c.wantOK || (ok && got != c.want) {
+				t.Errorf("limitRequestFactor() = (%v, %v), want (%v, %v)", got, ok, c.want, c.wantOK)
+			}
+		})
+	}
+}
+
+func TestEffectiveUserContainerResources(t *testing.T) {
+	container := &corev1.Container{
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("100m"),
+				corev1.ResourceMemory: resource.MustParse("128Mi"),
+			},
+		},
+	}
+
+	t.Run("no factor annotations leaves limits untouched", func(t *testing.T) {
+		_, limits := effectiveUserContainerResources(nil, container)
+		if len(limits) != 0 {
+			t.Errorf("limits = %v, want empty", limits)
+		}
+	})
+
+	t.Run("cpu factor scales the cpu request into a limit", func(t *testing.T) {
+		annotations := map[string]string{cpuLimitRequestFactorAnnotation: "2"}
+		_, limits := effectiveUserContainerResources(annotations, container)
+
+		want := resource.MustParse("200m")
+		if got := limits.Cpu(); got.Cmp(want) != 0 {
+			t.Errorf("cpu limit = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("memory factor scales the memory request into a limit", func(t *testing.T) {
+		annotations := map[string]string{memoryLimitRequestFactorAnnotation: "1.5"}
+		_, limits := effectiveUserContainerResources(annotations, container)
+
+		want := resource.MustParse("192Mi")
+		if got := limits.Memory(); got.Cmp(want) != 0 {
+			t.Errorf("memory limit = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("factor is ignored when the corresponding request is zero", func(t *testing.T) {
+		noRequests := &corev1.Container{}
+		annotations := map[string]string{cpuLimitRequestFactorAnnotation: "2"}
+		_, limits := effectiveUserContainerResources(annotations, noRequests)
+
+		if !limits.Cpu().IsZero() {
+			t.Errorf("cpu limit = %v, want zero", limits.Cpu())
+		}
+	})
+}
+
+func TestNeedsStartupProbe(t *testing.T) {
+	cases := []struct {
+		name        string
+		probe       *corev1.Probe
+		annotations map[string]string
+		want        bool
+	}{{
+		name:  "no annotation, modest readiness probe",
+		probe: &corev1.Probe{FailureThreshold: 3, InitialDelaySeconds: 0},
+		want:  false,
+	}, {
+		name:        "explicit annotation always wins",
+		probe:       &corev1.Probe{FailureThreshold: 1, InitialDelaySeconds: 0},
+		annotations: map[string]string{startupGracePeriodAnnotation: "60"},
+		want:        true,
+	}, {
+		name:  "high failure threshold implies slow start",
+		probe: &corev1.Probe{FailureThreshold: slowStartFailureThreshold + 1},
+		want:  true,
+	}, {
+		name:  "high initial delay implies slow start",
+		probe: &corev1.Probe{InitialDelaySeconds: slowStartInitialDelaySeconds + 1},
+		want:  true,
+	}, {
+		name:  "exactly at the threshold does not trigger",
+		probe: &corev1.Probe{FailureThreshold: slowStartFailureThreshold, InitialDelaySeconds: slowStartInitialDelaySeconds},
+		want:  false,
+	}, {
+		name: "no readinessProbe and no annotation",
+		want: false,
+	}, {
+		name:        "no readinessProbe but annotation still triggers it",
+		annotations: map[string]string{startupGracePeriodAnnotation: "60"},
+		want:        true,
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := needsStartupProbe(c.probe, c.annotations); got != c.want {
+				t.Errorf("needsStartupProbe() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestStartupProbeFailureThresholdFor(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        int32
+	}{{
+		name: "no annotation uses default",
+		want: defaultStartupProbeFailureThreshold,
+	}, {
+		name:        "valid annotation is honored",
+		annotations: map[string]string{startupGracePeriodAnnotation: "45"},
+		want:        45,
+	}, {
+		name:        "non-numeric annotation falls back to default",
+		annotations: map[string]string{startupGracePeriodAnnotation: "not-a-number"},
+		want:        defaultStartupProbeFailureThreshold,
+	}, {
+		name:        "non-positive annotation falls back to default",
+		annotations: map[string]string{startupGracePeriodAnnotation: "0"},
+		want:        defaultStartupProbeFailureThreshold,
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := startupProbeFailureThresholdFor(c.annotations); got != c.want {
+				t.Errorf("startupProbeFailureThresholdFor() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestStartupProbeBase(t *testing.T) {
+	servingPort := corev1.ContainerPort{ContainerPort: 8012}
+
+	t.Run("reuses the readiness http probe when there is one", func(t *testing.T) {
+		httpProbe := &corev1.Probe{FailureThreshold: 7}
+		if got := startupProbeBase(httpProbe, servingPort); got != httpProbe {
+			t.Errorf("startupProbeBase() = %v, want the same httpProbe instance", got)
+		}
+	})
+
+	t.Run("builds its own HTTPGet probe when there is no readinessProbe", func(t *testing.T) {
+		got := startupProbeBase(nil, servingPort)
+		if got.HTTPGet == nil {
+			t.Fatal("HTTPGet = nil, want non-nil")
+		}
+		if want := intstr.FromInt(int(servingPort.ContainerPort)); got.HTTPGet.Port != want {
+			t.Errorf("HTTPGet.Port = %v, want %v", got.HTTPGet.Port, want)
+		}
+	})
+}
+
+func TestApplyReadinessProbeDefaultsForExecGRPCIsUntouched(t *testing.T) {
+	svc := "user-service"
+	p := &corev1.Probe{
+		Handler: corev1.Handler{
+			GRPC: &corev1.GRPCAction{
+				Port:    8080,
+				Service: &svc,
+			},
+		},
+	}
+
+	applyReadinessProbeDefaultsForExec(p, 1234)
+
+	// No grpc.health.v1 client exists in pkg/queue/readiness to act on a
+	// localized GRPC probe, so it must pass through exactly as given.
+	if got, want := p.GRPC.Port, int32(8080); got != want {
+		t.Errorf("GRPC.Port = %d, want %d (unchanged)", got, want)
+	}
+	if p.GRPC.Service == nil || *p.GRPC.Service != svc {
+		t.Errorf("GRPC.Service = %v, want %q", p.GRPC.Service, svc)
+	}
+}
+
+func TestQueueProxyAppArmorProfile(t *testing.T) {
+	cases := []struct {
+		name        string
+		cfg         *deployment.Config
+		annotations map[string]string
+		want        string
+		wantOK      bool
+	}{{
+		name: "nothing configured leaves it unset",
+		cfg:  &deployment.Config{},
+	}, {
+		name:   "cluster default is used when no annotation is set",
+		cfg:    &deployment.Config{QueueSidecarAppArmorProfile: "RuntimeDefault"},
+		want:   "runtime/default",
+		wantOK: true,
+	}, {
+		name:        "per-revision annotation overrides the cluster default",
+		cfg:         &deployment.Config{QueueSidecarAppArmorProfile: "RuntimeDefault"},
+		annotations: map[string]string{appArmorProfileAnnotation: "Unconfined"},
+		want:        "unconfined",
+		wantOK:      true,
+	}, {
+		name:        "localhost profile is prefixed for the apparmor annotation",
+		cfg:         &deployment.Config{},
+		annotations: map[string]string{appArmorProfileAnnotation: "Localhost:profiles/queue-proxy"},
+		want:        "localhost/profiles/queue-proxy",
+		wantOK:      true,
+	}, {
+		name:        "localhost profile with no path is rejected",
+		cfg:         &deployment.Config{},
+		annotations: map[string]string{appArmorProfileAnnotation: "Localhost:"},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := queueProxyAppArmorProfile(c.cfg, c.annotations)
+			if ok != c.wantOK || got != c.want {
+				t.Errorf("queueProxyAppArmorProfile() = (%q, %v), want (%q, %v)", got, ok, c.want, c.wantOK)
+			}
+		})
+	}
+}
+
+func TestSeccompProfileFor(t *testing.T) {
+	cases := []struct {
+		name        string
+		cfg         *deployment.Config
+		annotations map[string]string
+		want        *corev1.SeccompProfile
+	}{{
+		name: "nothing configured leaves it unset",
+		cfg:  &deployment.Config{},
+		want: nil,
+	}, {
+		name: "cluster default is used when no annotation is set",
+		cfg:  &deployment.Config{QueueSidecarSeccompProfile: "RuntimeDefault"},
+		want: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+	}, {
+		name:        "per-revision annotation overrides the cluster default",
+		cfg:         &deployment.Config{QueueSidecarSeccompProfile: "RuntimeDefault"},
+		annotations: map[string]string{seccompProfileAnnotation: "Unconfined"},
+		want:        &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined},
+	}, {
+		name:        "localhost profile carries its path through",
+		cfg:         &deployment.Config{},
+		annotations: map[string]string{seccompProfileAnnotation: "Localhost:profiles/queue-proxy.json"},
+		want: &corev1.SeccompProfile{
+			Type:             corev1.SeccompProfileTypeLocalhost,
+			LocalhostProfile: ptr.String("profiles/queue-proxy.json"),
+		},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := seccompProfileFor(c.cfg, c.annotations)
+			if (got == nil) != (c.want == nil) {
+				t.Fatalf("seccompProfileFor() = %v, want %v", got, c.want)
+			}
+			if got == nil {
+				return
+			}
+			if got.Type != c.want.Type {
+				t.Errorf("Type = %v, want %v", got.Type, c.want.Type)
+			}
+			gotLocal, wantLocal := got.LocalhostProfile, c.want.LocalhostProfile
+			if (gotLocal == nil) != (wantLocal == nil) || (gotLocal != nil && *gotLocal != *wantLocal) {
+				t.Errorf("LocalhostProfile = %v, want %v", gotLocal, wantLocal)
+			}
+		})
+	}
+}